@@ -0,0 +1,132 @@
+// Package ber implements a minimal BER-TLV decoder, as used throughout
+// ISO/IEC 7816-4 and gemSpec_COS for card data objects (EF.GDO, EF.DIR,
+// chained extended-length responses, ...).
+package ber
+
+import "fmt"
+
+// TLV is a single BER-TLV encoded data object. Constructed objects
+// additionally have their value parsed into Children.
+type TLV struct {
+	Tag      uint32
+	Length   int
+	Value    []byte
+	Children []TLV
+}
+
+// isConstructed reports whether tag's constructed bit (0x20 of the
+// first tag byte) is set.
+func isConstructed(tag uint32) bool {
+	n := 1
+	for t := tag >> 8; t != 0; t >>= 8 {
+		n++
+	}
+	return tag>>((n-1)*8)&0x20 != 0
+}
+
+// ParseBER parses data as a sequence of BER-TLV encoded data objects.
+func ParseBER(data []byte) ([]TLV, error) {
+	var tlvs []TLV
+	for len(data) > 0 {
+		tlv, rest, err := parseOne(data)
+		if err != nil {
+			return nil, err
+		}
+		tlvs = append(tlvs, tlv)
+		data = rest
+	}
+	return tlvs, nil
+}
+
+func parseOne(data []byte) (tlv TLV, rest []byte, err error) {
+	tag, data, err := parseTag(data)
+	if err != nil {
+		return TLV{}, nil, err
+	}
+	length, data, err := parseLength(data)
+	if err != nil {
+		return TLV{}, nil, err
+	}
+	if len(data) < length {
+		return TLV{}, nil, fmt.Errorf("ber: value shorter than length (tag %#x, want %d, have %d)", tag, length, len(data))
+	}
+
+	tlv = TLV{Tag: tag, Length: length, Value: data[:length]}
+	if isConstructed(tag) {
+		children, err := ParseBER(tlv.Value)
+		if err != nil {
+			return TLV{}, nil, err
+		}
+		tlv.Children = children
+	}
+
+	return tlv, data[length:], nil
+}
+
+func parseTag(data []byte) (tag uint32, rest []byte, err error) {
+	if len(data) == 0 {
+		return 0, nil, fmt.Errorf("ber: truncated tag")
+	}
+	tag = uint32(data[0])
+	data = data[1:]
+	if data0 := byte(tag); data0&0x1f == 0x1f {
+		for {
+			if len(data) == 0 {
+				return 0, nil, fmt.Errorf("ber: truncated tag")
+			}
+			tag = tag<<8 | uint32(data[0])
+			more := data[0]&0x80 != 0
+			data = data[1:]
+			if !more {
+				break
+			}
+		}
+	}
+	return tag, data, nil
+}
+
+func parseLength(data []byte) (length int, rest []byte, err error) {
+	if len(data) == 0 {
+		return 0, nil, fmt.Errorf("ber: truncated length")
+	}
+	if data[0] < 0x80 {
+		return int(data[0]), data[1:], nil
+	}
+	n := int(data[0] &^ 0x80)
+	if n == 0 {
+		return 0, nil, fmt.Errorf("ber: indefinite length not supported")
+	}
+	if n > 4 || len(data) < 1+n {
+		return 0, nil, fmt.Errorf("ber: invalid length encoding")
+	}
+	for _, b := range data[1 : 1+n] {
+		length = length<<8 | int(b)
+	}
+	return length, data[1+n:], nil
+}
+
+// Find returns the first top-level data object in tlvs with the given
+// tag.
+func Find(tlvs []TLV, tag uint32) (TLV, bool) {
+	for _, t := range tlvs {
+		if t.Tag == tag {
+			return t, true
+		}
+	}
+	return TLV{}, false
+}
+
+// FindPath descends into nested constructed data objects, returning
+// the data object found by following path from the top of tlvs.
+func FindPath(tlvs []TLV, path ...uint32) (TLV, bool) {
+	var t TLV
+	var ok bool
+	for _, tag := range path {
+		t, ok = Find(tlvs, tag)
+		if !ok {
+			return TLV{}, false
+		}
+		tlvs = t.Children
+	}
+	return t, ok
+}
@@ -0,0 +1,122 @@
+package ber
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseBERPrimitive(t *testing.T) {
+	// Tag '5A', length 10, a GDO-shaped ICCSN value.
+	data := mustDecode(t, "5a0a80000000000000000000")
+
+	tlvs, err := ParseBER(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tlvs) != 1 {
+		t.Fatalf("got %d tlvs, want 1", len(tlvs))
+	}
+	if tlvs[0].Tag != 0x5a {
+		t.Errorf("Tag = %#x, want 0x5a", tlvs[0].Tag)
+	}
+	if tlvs[0].Length != 10 {
+		t.Errorf("Length = %d, want 10", tlvs[0].Length)
+	}
+	if tlvs[0].Children != nil {
+		t.Errorf("Children = %v, want nil (primitive tag)", tlvs[0].Children)
+	}
+}
+
+func TestParseBERConstructedNested(t *testing.T) {
+	// An EF.DIR application template (tag '61', constructed) with a
+	// nested AID (tag '4F') and label (tag '50').
+	data := mustDecode(t, "610e4f07d27600014480005003484341")
+
+	tlvs, err := ParseBER(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, ok := Find(tlvs, 0x61)
+	if !ok {
+		t.Fatal("missing application template")
+	}
+	if len(tmpl.Children) != 2 {
+		t.Fatalf("got %d children, want 2", len(tmpl.Children))
+	}
+
+	aid, ok := Find(tmpl.Children, 0x4f)
+	if !ok {
+		t.Fatal("missing AID")
+	}
+	if got, want := hex.EncodeToString(aid.Value), "d2760001448000"; got != want {
+		t.Errorf("AID = %q, want %q", got, want)
+	}
+
+	label, ok := Find(tmpl.Children, 0x50)
+	if !ok {
+		t.Fatal("missing label")
+	}
+	if got, want := string(label.Value), "HCA"; got != want {
+		t.Errorf("label = %q, want %q", got, want)
+	}
+
+	if _, ok := FindPath(tlvs, 0x61, 0x4f); !ok {
+		t.Error("FindPath(0x61, 0x4f): not found")
+	}
+	if _, ok := FindPath(tlvs, 0x61, 0x51); ok {
+		t.Error("FindPath(0x61, 0x51): unexpectedly found")
+	}
+}
+
+func TestParseBERTruncatedLength(t *testing.T) {
+	// Tag '5A' claims a 10-byte value but only 3 bytes follow.
+	data := mustDecode(t, "5a0a800000")
+
+	if _, err := ParseBER(data); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestParseBERTruncatedTag(t *testing.T) {
+	// A single byte with the multi-byte tag marker set but no
+	// continuation byte.
+	data := []byte{0x1f}
+
+	if _, err := ParseBER(data); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestParseBERIndefiniteLengthRejected(t *testing.T) {
+	// Tag '61', length byte '80' (indefinite form), which this decoder
+	// does not support.
+	data := mustDecode(t, "6180")
+
+	_, err := ParseBER(data)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	const want = "ber: indefinite length not supported"
+	if err.Error() != want {
+		t.Errorf("err = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestFindMissing(t *testing.T) {
+	tlvs, err := ParseBER(mustDecode(t, "5a0a80000000000000000000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Find(tlvs, 0x61); ok {
+		t.Error("Find(0x61): unexpectedly found")
+	}
+}
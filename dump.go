@@ -0,0 +1,89 @@
+package main
+
+import "encoding/hex"
+
+// FileResult is the structured outcome of reading a single elementary
+// file: its raw contents, the error (typically a cardError carrying
+// the SW) that was returned instead, or both when the file was read
+// but its contents failed to parse.
+type FileResult struct {
+	Hex   string `json:"hex,omitempty" msgpack:"hex,omitempty"`
+	Error string `json:"error,omitempty" msgpack:"error,omitempty"`
+}
+
+func fileResult(raw []byte, err error) FileResult {
+	if err != nil {
+		return FileResult{Error: err.Error()}
+	}
+	return FileResult{Hex: hex.EncodeToString(raw)}
+}
+
+// DirEntry is a single EF.DIR record, decoded as an application
+// template when it parses as one.
+type DirEntry struct {
+	Index int    `json:"index" msgpack:"index"`
+	AID   string `json:"aid,omitempty" msgpack:"aid,omitempty"`
+	Label string `json:"label,omitempty" msgpack:"label,omitempty"`
+	FileResult
+}
+
+// VersionFile is an EF.Version record together with its decoded BCD
+// version string, when parsing succeeded.
+type VersionFile struct {
+	Index   int    `json:"index" msgpack:"index"`
+	Version string `json:"version,omitempty" msgpack:"version,omitempty"`
+	FileResult
+}
+
+// CertFile is a raw, DER-encoded certificate file read from the MF,
+// named after the elementary file it came from.
+type CertFile struct {
+	Name string `json:"name" msgpack:"name"`
+	FileResult
+}
+
+// MFDump is the structured result of dumping the master file.
+type MFDump struct {
+	ATR     FileResult    `json:"atr" msgpack:"atr"`
+	Dir     []DirEntry    `json:"dir" msgpack:"dir"`
+	GDO     FileResult    `json:"gdo" msgpack:"gdo"`
+	ICCSN   *ICCSN        `json:"iccsn,omitempty" msgpack:"iccsn,omitempty"`
+	Version []VersionFile `json:"version" msgpack:"version"`
+	Certs   []CertFile    `json:"certs" msgpack:"certs"`
+}
+
+// CertResult is an eSign certificate file: its raw contents as hex, and,
+// when it parses as a certificate, its subject, issuer and PEM encoding.
+type CertResult struct {
+	FileResult
+	Subject string `json:"subject,omitempty" msgpack:"subject,omitempty"`
+	Issuer  string `json:"issuer,omitempty" msgpack:"issuer,omitempty"`
+	PEM     string `json:"pem,omitempty" msgpack:"pem,omitempty"`
+}
+
+// HCADump is the structured result of dumping the HCA (Versichertendaten)
+// application.
+type HCADump struct {
+	StatusVD       FileResult `json:"statusvd" msgpack:"statusvd"`
+	StatusVDParsed *StatusVD  `json:"statusvd_parsed,omitempty" msgpack:"statusvd_parsed,omitempty"`
+	PD             FileResult `json:"pd" msgpack:"pd"`
+	PDParsed       *PD        `json:"pd_parsed,omitempty" msgpack:"pd_parsed,omitempty"`
+	VD             FileResult `json:"vd" msgpack:"vd"`
+	VDParsed       *VD        `json:"vd_parsed,omitempty" msgpack:"vd_parsed,omitempty"`
+	GVD            FileResult `json:"gvd" msgpack:"gvd"`
+	GVDParsed      *GVD       `json:"gvd_parsed,omitempty" msgpack:"gvd_parsed,omitempty"`
+}
+
+// EsignDump is the structured result of dumping the eSign application.
+type EsignDump struct {
+	CAut CertResult `json:"c_ch_aut" msgpack:"c_ch_aut"`
+	CEnc CertResult `json:"c_ch_enc" msgpack:"c_ch_enc"`
+}
+
+// CardDump is the top-level, machine-readable result of a full dump
+// run, as emitted by the -format=json/msgpack flag.
+type CardDump struct {
+	MF    *MFDump    `json:"mf,omitempty" msgpack:"mf,omitempty"`
+	HCA   *HCADump   `json:"hca,omitempty" msgpack:"hca,omitempty"`
+	Esign *EsignDump `json:"esign,omitempty" msgpack:"esign,omitempty"`
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// openTranscript opens the recorded APDU transcript used to exercise
+// dumpRoot/dumpHCA/dumpEsign without a physical card.
+func openTranscript(t *testing.T) *ReplayCard {
+	t.Helper()
+	f, err := os.Open("testdata/dump.transcript")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	card, err := NewReplayCard(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return card
+}
+
+func TestDumpRoot(t *testing.T) {
+	card := openTranscript(t)
+	dump := dumpRoot(card)
+
+	if dump.ATR.Error != "" {
+		t.Errorf("ATR: unexpected error %q", dump.ATR.Error)
+	}
+
+	if len(dump.Dir) != 10 {
+		t.Fatalf("Dir: got %d entries, want 10", len(dump.Dir))
+	}
+	if got, want := dump.Dir[0].AID, "d2760001448000"; got != want {
+		t.Errorf("Dir[0].AID = %q, want %q", got, want)
+	}
+	if got, want := dump.Dir[0].Label, "HCA"; got != want {
+		t.Errorf("Dir[0].Label = %q, want %q", got, want)
+	}
+	for i := 1; i < len(dump.Dir); i++ {
+		if dump.Dir[i].Error == "" {
+			t.Errorf("Dir[%d]: expected error, got none", i)
+		}
+	}
+
+	if dump.GDO.Error != "" {
+		t.Fatalf("GDO: unexpected error %q", dump.GDO.Error)
+	}
+	if dump.ICCSN == nil {
+		t.Fatal("ICCSN: not parsed")
+	}
+	if dump.ICCSN.MajorIndustryIdentifier != 0x80 {
+		t.Errorf("ICCSN.MajorIndustryIdentifier = %#x, want 0x80", dump.ICCSN.MajorIndustryIdentifier)
+	}
+
+	if len(dump.Version) != 4 {
+		t.Fatalf("Version: got %d entries, want 4", len(dump.Version))
+	}
+	if got, want := dump.Version[0].Version, "0.102.5"; got != want {
+		t.Errorf("Version[0].Version = %q, want %q", got, want)
+	}
+	for i := 1; i < len(dump.Version); i++ {
+		if dump.Version[i].Error == "" {
+			t.Errorf("Version[%d]: expected error, got none", i)
+		}
+	}
+
+	if len(dump.Certs) != 6 {
+		t.Fatalf("Certs: got %d entries, want 6", len(dump.Certs))
+	}
+	for _, c := range dump.Certs {
+		if c.Error == "" {
+			t.Errorf("Cert %s: expected error, got none", c.Name)
+		}
+	}
+
+	t.Run("HCA", func(t *testing.T) {
+		hca := dumpHCA(card)
+		if hca.StatusVD.Error != "" {
+			t.Fatalf("StatusVD: unexpected error %q", hca.StatusVD.Error)
+		}
+		if hca.StatusVDParsed == nil {
+			t.Fatal("StatusVD: not parsed")
+		}
+		if got, want := hca.StatusVDParsed.Status, "1"; got != want {
+			t.Errorf("StatusVD.Status = %q, want %q", got, want)
+		}
+		if got, want := hca.StatusVDParsed.Version, "10.203.405"; got != want {
+			t.Errorf("StatusVD.Version = %q, want %q", got, want)
+		}
+		if hca.PD.Error == "" {
+			t.Error("PD: expected error, got none")
+		}
+		if hca.VD.Error == "" {
+			t.Error("VD: expected error, got none")
+		}
+		if hca.GVD.Error == "" {
+			t.Error("GVD: expected error, got none")
+		}
+
+		t.Run("Esign", func(t *testing.T) {
+			esign := dumpEsign(card)
+			if esign.CAut.Error == "" {
+				t.Error("CAut: expected error, got none")
+			}
+			if esign.CEnc.Error == "" {
+				t.Error("CEnc: expected error, got none")
+			}
+		})
+	})
+}
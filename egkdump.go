@@ -3,10 +3,13 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/elliptic"
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"encoding/xml"
 	"flag"
 	"fmt"
@@ -15,8 +18,11 @@ import (
 
 	"code.google.com/p/go-charset/charset"
 	_ "code.google.com/p/go-charset/data"
+	"github.com/ebfe/egkdump/ber"
+	"github.com/ebfe/egkdump/sm"
 	"github.com/ebfe/scard"
-	"github.com/kr/pretty"
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/term"
 )
 
 var (
@@ -44,6 +50,9 @@ const (
 
 	efcchaut = 1
 	efcchenc = 2
+
+	pinCH   = 0x01 // PIN.CH, verified within the HCA/eSign application
+	pinHome = 0x02 // PIN.home, the global "Home" PIN valid card-wide
 )
 
 type Card interface {
@@ -103,19 +112,6 @@ func selectAid(card Card, aid []byte) error {
 	return nil
 }
 
-func readBinary(card Card, offset uint16, le int) ([]byte, error) {
-	apdu := EncodeAPDU(0x00, 0xb0, byte(offset>>8), byte(offset), nil, le)
-	rapdu, err := card.Transmit(apdu)
-	if err != nil {
-		return nil, err
-	}
-	sw, data := DecodeResponseAPDU(rapdu)
-	if sw != 0x9000 {
-		return nil, cardError(sw)
-	}
-	return data, nil
-}
-
 func readBinarySfid(card Card, sfid byte, offset byte, le int) ([]byte, error) {
 	apdu := EncodeAPDU(0x00, 0xb0, 0x80|sfid, offset, nil, le)
 	rapdu, err := card.Transmit(apdu)
@@ -206,67 +202,88 @@ func (sn *ICCSN) UnmarshalBinary(raw []byte) error {
 	return nil
 }
 
-func parseGDO(raw []byte) (*ICCSN, error) {
-	if len(raw) != 12 {
-		return nil, fmt.Errorf("too short")
+const (
+	tagGDO                 = 0x5a
+	tagApplicationTemplate = 0x61
+	tagAID                 = 0x4f
+	tagLabel               = 0x50
+)
+
+// parseDirRecord decodes an EF.DIR record as an application template
+// (tag '61'), extracting the AID (tag '4F') and label (tag '50') of
+// the application it describes.
+func parseDirRecord(raw []byte) (aid, label string, err error) {
+	tlvs, err := ber.ParseBER(raw)
+	if err != nil {
+		return "", "", err
+	}
+	tmpl, ok := ber.Find(tlvs, tagApplicationTemplate)
+	if !ok {
+		return "", "", fmt.Errorf("missing application template (tag %#x)", tagApplicationTemplate)
+	}
+	if t, ok := ber.Find(tmpl.Children, tagAID); ok {
+		aid = hex.EncodeToString(t.Value)
 	}
+	if t, ok := ber.Find(tmpl.Children, tagLabel); ok {
+		label = string(t.Value)
+	}
+	return aid, label, nil
+}
 
-	if raw[0] != 0x5a {
-		return nil, fmt.Errorf("bad tag (%x)", raw[0])
+func parseGDO(raw []byte) (*ICCSN, error) {
+	tlvs, err := ber.ParseBER(raw)
+	if err != nil {
+		return nil, err
 	}
-	if raw[1] != 0x0a {
-		return nil, fmt.Errorf("invalid length (%x)", raw[1])
+	tlv, ok := ber.Find(tlvs, tagGDO)
+	if !ok {
+		return nil, fmt.Errorf("missing tag %#x", tagGDO)
 	}
 
 	var sn ICCSN
-	err := sn.UnmarshalBinary(raw[2:])
-	if err != nil {
+	if err := sn.UnmarshalBinary(tlv.Value); err != nil {
 		return nil, err
 	}
 	return &sn, nil
 }
 
-func dumpRoot(card Card) {
-	fmt.Println("mf/ef.atr")
+func dumpRoot(card Card) *MFDump {
+	var dump MFDump
+
 	atr, err := readBinarySfid(card, efatr, 0, apduMaxShort)
-	if err != nil {
-		fmt.Printf("\terr: %s\n", err)
-	} else {
-		fmt.Printf("\t%s\n", hex.EncodeToString(atr))
-	}
+	dump.ATR = fileResult(atr, err)
 
-	fmt.Println("mf/ef.dir")
 	for i := byte(1); i < 11; i++ {
 		dir, err := readRecordSfid(card, efdir, i, apduMaxShort)
-		if err != nil {
-			fmt.Printf("\t[%d] err: %s\n", i, err)
-		} else {
-			fmt.Printf("\t[%d]: %s\n", i, hex.EncodeToString(dir))
+		entry := DirEntry{Index: int(i), FileResult: fileResult(dir, err)}
+		if err == nil {
+			aid, label, err := parseDirRecord(dir)
+			if err == nil {
+				entry.AID = aid
+				entry.Label = label
+			} else {
+				entry.Error = err.Error()
+			}
 		}
+		dump.Dir = append(dump.Dir, entry)
 	}
 
-	fmt.Println("mf/ef.gdo")
 	gdo, err := readBinarySfid(card, efgdo, 0, apduMaxShort)
-	if err != nil {
-		fmt.Printf("\terr: %s\n", err)
-	} else {
-		fmt.Printf("\t%s\n", hex.EncodeToString(gdo))
+	dump.GDO = fileResult(gdo, err)
+	if err == nil {
 		sn, err := parseGDO(gdo)
-		if err != nil {
-			fmt.Printf("\tparse error: %s\n", err)
-		} else {
-			pretty.Printf("\t%# v\n", sn)
+		if err == nil {
+			dump.ICCSN = sn
 		}
 	}
 
-	fmt.Println("mf/ef.version")
 	for i := byte(1); i < 5; i++ {
 		version, err := readRecordSfid(card, efversion, i, apduMaxShort)
-		if err != nil {
-			fmt.Printf("\t[%d] err: %s\n", i, err)
-		} else {
-			fmt.Printf("\t[%d]: %s // %q\n", i, hex.EncodeToString(version), parseBCDVersion(version))
+		vf := VersionFile{Index: int(i), FileResult: fileResult(version, err)}
+		if err == nil {
+			vf.Version = parseBCDVersion(version)
 		}
+		dump.Version = append(dump.Version, vf)
 	}
 
 	var certs = []struct {
@@ -282,14 +299,11 @@ func dumpRoot(card Card) {
 	}
 
 	for _, c := range certs {
-		fmt.Println(c.name)
 		raw, err := readBinarySfid(card, c.sfid, 0, apduMaxExtended)
-		if err != nil {
-			fmt.Printf("\terr: %s\n", err)
-		} else {
-			fmt.Print(hex.Dump(raw))
-		}
+		dump.Certs = append(dump.Certs, CertFile{Name: c.name, FileResult: fileResult(raw, err)})
 	}
+
+	return &dump
 }
 
 type StatusVD struct {
@@ -425,105 +439,150 @@ func (gvd *GVD) UnmarshalBinary(raw []byte) error {
 	return parseGzippedXml(raw, gvd)
 }
 
-func dumpHCA(card Card) {
-	fmt.Println("hca/ef.statusvd")
+func dumpHCA(card Card) *HCADump {
+	var dump HCADump
+
 	statusvd, err := readBinarySfid(card, efstatusvd, 0, apduMaxExtended)
-	if err != nil {
-		fmt.Printf("hca/ef.statusvd err: %s\n", err)
-	} else {
+	dump.StatusVD = fileResult(statusvd, err)
+	if err == nil {
 		var svd StatusVD
-		err := svd.UnmarshalBinary(statusvd)
-		if err != nil {
-			fmt.Printf("parse err: %s\n", err)
+		if err := svd.UnmarshalBinary(statusvd); err == nil {
+			dump.StatusVDParsed = &svd
 		} else {
-			pretty.Printf("%# v\n", svd)
+			dump.StatusVD.Error = err.Error()
 		}
 	}
 
-	fmt.Println("hca/ef.pd")
 	rawpd, err := readBinarySfid(card, efpd, 0, apduMaxExtended)
-	if err != nil {
-		fmt.Printf("\terr: %s\n", err)
-	} else {
+	dump.PD = fileResult(rawpd, err)
+	if err == nil {
 		if len(rawpd) < 2 {
-			fmt.Printf("pd data too short")
-		}
-
-		pdlen := int(binary.BigEndian.Uint16(rawpd))
-		if pdlen > len(rawpd)-2 {
-			fmt.Printf("pd invalid length %d (avail %d)\n", pdlen, len(rawpd))
-		}
-
-		var pd PD
-		err := pd.UnmarshalBinary(rawpd[2 : 2+pdlen])
-		if err != nil {
-			fmt.Printf("\tparse error: %s\n", err)
-			fmt.Println(hex.Dump(rawpd))
+			dump.PD.Error = "pd data too short"
 		} else {
-			pretty.Println(pd)
+			pdlen := int(binary.BigEndian.Uint16(rawpd))
+			if pdlen > len(rawpd)-2 {
+				dump.PD.Error = fmt.Sprintf("pd invalid length %d (avail %d)", pdlen, len(rawpd)-2)
+			} else {
+				var pd PD
+				if err := pd.UnmarshalBinary(rawpd[2 : 2+pdlen]); err == nil {
+					dump.PDParsed = &pd
+				} else {
+					dump.PD.Error = err.Error()
+				}
+			}
 		}
 	}
 
-	fmt.Println("hca/ef.vd")
 	raw, err := readBinarySfid(card, efvd, 0, apduMaxExtended)
 	if err != nil {
-		fmt.Printf("\terr: %s\n", err)
-	} else {
-		if len(raw) < 8 {
-			fmt.Printf("ef.vd data too short")
-			fmt.Println(hex.Dump(raw))
-		}
+		dump.VD = fileResult(nil, err)
+		dump.GVD = fileResult(nil, err)
+		return &dump
+	}
 
-		vdstart := int(binary.BigEndian.Uint16(raw))
-		vdend := int(binary.BigEndian.Uint16(raw[2:]))
-		gvdstart := int(binary.BigEndian.Uint16(raw[4:]))
-		gvdend := int(binary.BigEndian.Uint16(raw[6:]))
+	if len(raw) < 8 {
+		dump.VD.Error = "ef.vd data too short"
+		dump.GVD.Error = "ef.vd data too short"
+		return &dump
+	}
 
-		if vdend < vdstart || vdend > len(raw) {
-			fmt.Printf("ef.vd vd invalid start/end offset %d/%d (avail %d)\n", vdstart, vdend, len(raw))
-		}
-		var vd VD
+	vdstart := int(binary.BigEndian.Uint16(raw))
+	vdend := int(binary.BigEndian.Uint16(raw[2:]))
+	gvdstart := int(binary.BigEndian.Uint16(raw[4:]))
+	gvdend := int(binary.BigEndian.Uint16(raw[6:]))
+
+	if vdend < vdstart || vdend > len(raw) {
+		dump.VD.Error = fmt.Sprintf("vd invalid start/end offset %d/%d (avail %d)", vdstart, vdend, len(raw))
+	} else {
 		vdraw := raw[vdstart:vdend]
-		err := vd.UnmarshalBinary(vdraw)
-		if err != nil {
-			fmt.Printf("\tparse error: %s\n", err)
-			fmt.Println(hex.Dump(vdraw))
+		dump.VD = fileResult(vdraw, nil)
+		var vd VD
+		if err := vd.UnmarshalBinary(vdraw); err == nil {
+			dump.VDParsed = &vd
 		} else {
-			pretty.Println(vd)
+			dump.VD.Error = err.Error()
 		}
+	}
 
-		if gvdend < gvdstart || gvdend > len(raw) {
-			fmt.Printf("ef.gvd gvd invalid start/end offset %d/%d (avail %d)\n", gvdstart, gvdend, len(raw))
-		}
-		var gvd GVD
+	if gvdend < gvdstart || gvdend > len(raw) {
+		dump.GVD.Error = fmt.Sprintf("gvd invalid start/end offset %d/%d (avail %d)", gvdstart, gvdend, len(raw))
+	} else {
 		gvdraw := raw[gvdstart:gvdend]
-		gvd.UnmarshalBinary(gvdraw)
-		if err != nil {
-			fmt.Printf("\tparse error: %s\n", err)
-			fmt.Println(hex.Dump(gvdraw))
+		dump.GVD = fileResult(gvdraw, nil)
+		var gvd GVD
+		if err := gvd.UnmarshalBinary(gvdraw); err == nil {
+			dump.GVDParsed = &gvd
 		} else {
-			pretty.Println(gvd)
+			dump.GVD.Error = err.Error()
 		}
 	}
+
+	return &dump
 }
 
+const insGetResponse = 0xc0
+
+// readBinaryChained transmits apdu (built by build for the given Le),
+// following SW1=0x61 (more response data, fetched via GET RESPONSE)
+// and SW1=0x6c (wrong Le, retried with the Le the card reports) until
+// a final status word is reached.
+func readBinaryChained(card Card, build func(le int) []byte, le int) ([]byte, error) {
+	rapdu, err := card.Transmit(build(le))
+	if err != nil {
+		return nil, err
+	}
+	sw, data := DecodeResponseAPDU(rapdu)
+
+	for sw>>8 == 0x61 {
+		rapdu, err := card.Transmit(EncodeAPDU(0x00, insGetResponse, 0x00, 0x00, nil, int(sw&0xff)))
+		if err != nil {
+			return nil, err
+		}
+		var rest []byte
+		sw, rest = DecodeResponseAPDU(rapdu)
+		data = append(data, rest...)
+	}
+
+	if sw>>8 == 0x6c {
+		return readBinaryChained(card, build, int(sw&0xff))
+	}
+
+	if sw != 0x9000 {
+		return nil, cardError(sw)
+	}
+	return data, nil
+}
+
+// readBinaryFull reads an entire transparent EF by READ BINARY at
+// increasing offsets, following SW=61xx/6Cxx chains on each read and
+// stopping once a read comes back shorter than requested (end of
+// file) rather than relying on a specific "past EOF" status word.
 func readBinaryFull(card Card, sfid byte) ([]byte, error) {
-	// FIXME: this sucks
-	raw, err := readBinarySfid(card, efcchaut, 0, apduMaxExtended)
+	raw, err := readBinaryChained(card, func(le int) []byte {
+		return EncodeAPDU(0x00, 0xb0, 0x80|sfid, 0x00, nil, le)
+	}, apduMaxExtended)
 	if err != nil {
 		return nil, err
 	}
+	if len(raw) < apduMaxExtended {
+		return raw, nil
+	}
+
 	for len(raw) < 1<<16 {
-		buf, err := readBinary(card, uint16(len(raw)), apduMaxExtended)
+		offset := uint16(len(raw))
+		buf, err := readBinaryChained(card, func(le int) []byte {
+			return EncodeAPDU(0x00, 0xb0, byte(offset>>8), byte(offset), nil, le)
+		}, apduMaxExtended)
 		if err != nil {
-			if cerr, ok := err.(cardError); ok {
-				if cerr == 0x6b00 {
-					return append(raw, buf...), nil
-				}
-			}
 			return nil, err
 		}
+		if len(buf) == 0 {
+			break
+		}
 		raw = append(raw, buf...)
+		if len(buf) < apduMaxExtended {
+			break
+		}
 	}
 	return raw, nil
 }
@@ -544,107 +603,212 @@ func parseCert(raw []byte) (*x509.Certificate, error) {
 	return x509.ParseCertificate(val.FullBytes)
 }
 
-func dumpEsign(card Card) {
-	fmt.Println("esign/ef.c.ch.aut")
-	var raw []byte
-	raw, err := readBinaryFull(card, efcchaut)
+func dumpEsignCert(card Card, sfid byte) CertResult {
+	raw, err := readBinaryFull(card, sfid)
 	if err != nil {
-		fmt.Printf("\terr: %s\n", err)
-	} else {
-		cert, err := parseCert(raw)
-		if err != nil {
-			fmt.Printf("\terr: %s\n", err)
-			fmt.Print(hex.Dump(raw))
-		} else {
-			fmt.Printf("\tsubject: %s\n", cert.Subject)
-			fmt.Printf("\tissuer: %s\n", cert.Issuer)
-			fmt.Print(hex.Dump(cert.Raw))
-		}
+		return CertResult{FileResult: fileResult(nil, err)}
 	}
-	fmt.Println("esign/ef.c.ch.enc")
-	raw, err = readBinaryFull(card, efcchenc)
+
+	result := CertResult{FileResult: fileResult(raw, nil)}
+	cert, err := parseCert(raw)
 	if err != nil {
-		fmt.Printf("\terr: %s\n", err)
-	} else {
-		cert, err := parseCert(raw)
-		if err != nil {
-			fmt.Printf("\terr: %s\n", err)
-			fmt.Print(hex.Dump(raw))
-		} else {
-			fmt.Printf("\tsubject: %s\n", cert.Subject)
-			fmt.Printf("\tissuer: %s\n", cert.Issuer)
-			fmt.Print(hex.Dump(cert.Raw))
-		}
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Subject = cert.Subject.String()
+	result.Issuer = cert.Issuer.String()
+	result.PEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	return result
+}
+
+func dumpEsign(card Card) *EsignDump {
+	return &EsignDump{
+		CAut: dumpEsignCert(card, efcchaut),
+		CEnc: dumpEsignCert(card, efcchenc),
 	}
 }
 
 var desc = []struct {
-	name string
-	aid  []byte
-	fn   func(card Card)
+	name     string
+	aid      []byte
+	needsPin bool // verify the -pin-ref CHV after selecting aid
+	fn       func(card Card) interface{}
 }{
 	{
 		name: "mf",
 		aid:  aidRootMF,
-		fn:   dumpRoot,
+		fn:   func(card Card) interface{} { return dumpRoot(card) },
 	}, {
-		name: "hca",
-		aid:  aidHCA,
-		fn:   dumpHCA,
+		name:     "hca",
+		aid:      aidHCA,
+		needsPin: true,
+		fn:       func(card Card) interface{} { return dumpHCA(card) },
 	}, {
 		name: "qes",
 		aid:  aidQES,
 		fn:   nil,
 	}, {
-		name: "esign",
-		aid:  aidEsign,
-		fn:   dumpEsign,
+		name:     "esign",
+		aid:      aidEsign,
+		needsPin: true,
+		fn:       func(card Card) interface{} { return dumpEsign(card) },
 	},
 }
 
 func main() {
 	traceApdus := flag.Bool("t", false, "trace apdus")
+	can := flag.String("can", "", "card access number, establishes a PACE trusted channel before dumping")
+	format := flag.String("format", "text", "dump output format: text, json or msgpack")
+	replayFile := flag.String("replay", "", "replay a recorded APDU transcript instead of using a physical card")
+	recordFile := flag.String("record", "", "record the APDU transcript to file, for later -replay")
+	pin := flag.String("pin", "", "PIN to verify before reading CHV-protected files, such as EF.StatusVD")
+	pinPrompt := flag.Bool("pin-prompt", false, "prompt for the PIN interactively instead of passing -pin")
+	pinRefFlag := flag.String("pin-ref", "ch", `which PIN to verify: "ch" (PIN.CH) or "home" (PIN.home)`)
 	flag.Parse()
 
-	ctx, err := scard.EstablishContext()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	var pinRef byte
+	switch *pinRefFlag {
+	case "ch":
+		pinRef = pinCH
+	case "home":
+		pinRef = pinHome
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -pin-ref %q\n", *pinRefFlag)
 		os.Exit(1)
 	}
-	defer ctx.Release()
 
-	sccard, err := findCard(ctx)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	if *pinPrompt {
+		fmt.Fprint(os.Stderr, "PIN: ")
+		raw, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		*pin = string(raw)
 	}
-	defer sccard.Disconnect(scard.ResetCard)
 
-	status, err := sccard.Status()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "card status: %s\n", err)
-		os.Exit(1)
-	}
+	var card Card
 
-	fmt.Printf("reader: %s\n", status.Reader)
-	fmt.Printf("atr: % x\n", status.Atr)
+	if *replayFile != "" {
+		f, err := os.Open(*replayFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		rc, err := NewReplayCard(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		card = rc
+	} else {
+		ctx, err := scard.EstablishContext()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer ctx.Release()
+
+		sccard, err := findCard(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer sccard.Disconnect(scard.ResetCard)
+
+		status, err := sccard.Status()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "card status: %s\n", err)
+			os.Exit(1)
+		}
 
-	var card Card = sccard
+		fmt.Fprintf(os.Stderr, "reader: %s\n", status.Reader)
+		fmt.Fprintf(os.Stderr, "atr: % x\n", status.Atr)
+
+		card = sccard
+	}
 
 	if *traceApdus {
 		card = newApduLogger(card, os.Stdout)
 	}
 
+	if *recordFile != "" {
+		f, err := os.Create(*recordFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		card = newApduLogger(card, f)
+	}
+
+	if *can != "" {
+		sc, err := sm.PACE(card, *can, elliptic.P256())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "pace: %s\n", err)
+			os.Exit(1)
+		}
+		card = sc
+	}
+
+	var dump CardDump
 	for _, d := range desc {
-		fmt.Printf("selecting %s: %x...\n", d.name, d.aid)
+		fmt.Fprintf(os.Stderr, "selecting %s: %x...\n", d.name, d.aid)
 		if err := selectAid(card, d.aid); err != nil {
-			fmt.Println(err)
-		} else {
-			if d.fn == nil {
-				fmt.Println("\tok")
-			} else {
-				d.fn(card)
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		if d.needsPin && *pin != "" {
+			if err := VerifyPin(card, pinRef, *pin, PinFormatISO9564F2); err != nil {
+				if n, ok := RetriesLeft(err); ok {
+					fmt.Fprintf(os.Stderr, "\tverify pin: %s (%d tries left)\n", err, n)
+				} else {
+					fmt.Fprintf(os.Stderr, "\tverify pin: %s\n", err)
+				}
 			}
 		}
+		if d.fn == nil {
+			fmt.Fprintln(os.Stderr, "\tok")
+			continue
+		}
+		switch v := d.fn(card).(type) {
+		case *MFDump:
+			dump.MF = v
+		case *HCADump:
+			dump.HCA = v
+		case *EsignDump:
+			dump.Esign = v
+		}
+	}
+
+	if err := writeDump(os.Stdout, &dump, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// writeDump renders dump to w in the given format (text, json or
+// msgpack).
+func writeDump(w io.Writer, dump *CardDump, format string) error {
+	switch format {
+	case "text":
+		printText(w, dump)
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(dump)
+	case "msgpack":
+		b, err := msgpack.Marshal(dump)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	default:
+		return fmt.Errorf("unknown -format %q", format)
 	}
 }
@@ -0,0 +1,148 @@
+package main
+
+import "fmt"
+
+// PinFormat selects how a PIN's digits are packed into the command
+// data of a VERIFY/CHANGE REFERENCE DATA/RESET RETRY COUNTER APDU.
+type PinFormat int
+
+const (
+	// PinFormatISO9564F2 packs the PIN as ISO 9564-1 format 2 packed
+	// BCD, as used for PIN.CH and PIN.home on the eGK: a control byte
+	// (0x2<<4 | number of digits), the digits packed two per byte,
+	// padded with 'F' nibbles up to 8 bytes total.
+	PinFormatISO9564F2 PinFormat = iota
+)
+
+const (
+	insVerify              = 0x20
+	insChangeReferenceData = 0x24
+	insResetRetryCounter   = 0x2c
+)
+
+// packPin encodes pin according to format.
+func packPin(pin string, format PinFormat) ([]byte, error) {
+	switch format {
+	case PinFormatISO9564F2:
+		return packPinISO9564F2(pin)
+	default:
+		return nil, fmt.Errorf("pin: unknown format %d", format)
+	}
+}
+
+// packPinISO9564F2 packs pin as ISO 9564-1 format 2: a control byte
+// (0x2<<4 | length), the digits packed two per byte, 'F'-padded up to
+// 8 bytes.
+func packPinISO9564F2(pin string) ([]byte, error) {
+	if len(pin) < 4 || len(pin) > 12 {
+		return nil, fmt.Errorf("pin: invalid length %d", len(pin))
+	}
+
+	packed := make([]byte, 8)
+	packed[0] = 0x20 | byte(len(pin))
+	for i := 1; i < len(packed); i++ {
+		packed[i] = 0xff
+	}
+
+	for i, c := range []byte(pin) {
+		if c < '0' || c > '9' {
+			return nil, fmt.Errorf("pin: non-digit %q", c)
+		}
+		d := c - '0'
+		pos := 1 + i/2
+		if i%2 == 0 {
+			packed[pos] = d<<4 | packed[pos]&0x0f
+		} else {
+			packed[pos] = packed[pos]&0xf0 | d
+		}
+	}
+
+	return packed, nil
+}
+
+// RetriesLeft reports the number of verification attempts left, as
+// coded by the card in SW1=0x63, SW2=0xCx ("counter x"). It returns
+// ok=false for any other status word.
+func RetriesLeft(err error) (n int, ok bool) {
+	ce, ok := err.(cardError)
+	if !ok || uint16(ce)>>8 != 0x63 || uint16(ce)&0xf0 != 0xc0 {
+		return 0, false
+	}
+	return int(uint16(ce) & 0x0f), true
+}
+
+// VerifyPin verifies pin against the CHV referenced by ref (e.g.
+// PIN.CH or PIN.home) within the currently selected application,
+// using a VERIFY command (INS '20'). Passing pin == "" sends VERIFY
+// with no command data (Lc absent), which per gemSpec_COS queries the
+// retry counter without attempting a verification.
+func VerifyPin(card Card, ref byte, pin string, format PinFormat) error {
+	var data []byte
+	if pin != "" {
+		packed, err := packPin(pin, format)
+		if err != nil {
+			return err
+		}
+		data = packed
+	}
+
+	apdu := EncodeAPDU(0x00, insVerify, 0x00, ref, data, 0)
+	rapdu, err := card.Transmit(apdu)
+	if err != nil {
+		return err
+	}
+	sw, _ := DecodeResponseAPDU(rapdu)
+	if sw != 0x9000 {
+		return cardError(sw)
+	}
+	return nil
+}
+
+// ChangeReferenceData changes the CHV referenced by ref from oldPin to
+// newPin using a CHANGE REFERENCE DATA command (INS '24').
+func ChangeReferenceData(card Card, ref byte, oldPin, newPin string, format PinFormat) error {
+	oldPacked, err := packPin(oldPin, format)
+	if err != nil {
+		return err
+	}
+	newPacked, err := packPin(newPin, format)
+	if err != nil {
+		return err
+	}
+
+	apdu := EncodeAPDU(0x00, insChangeReferenceData, 0x00, ref, append(oldPacked, newPacked...), 0)
+	rapdu, err := card.Transmit(apdu)
+	if err != nil {
+		return err
+	}
+	sw, _ := DecodeResponseAPDU(rapdu)
+	if sw != 0x9000 {
+		return cardError(sw)
+	}
+	return nil
+}
+
+// ResetRetryCounter unblocks the CHV referenced by ref and sets it to
+// newPin, using a RESET RETRY COUNTER command (INS '2C') carrying the
+// PUK followed by the new PIN.
+func ResetRetryCounter(card Card, ref byte, puk, newPin string, format PinFormat) error {
+	pukPacked, err := packPin(puk, format)
+	if err != nil {
+		return err
+	}
+	newPacked, err := packPin(newPin, format)
+	if err != nil {
+		return err
+	}
+
+	apdu := EncodeAPDU(0x00, insResetRetryCounter, 0x00, ref, append(pukPacked, newPacked...), 0)
+	rapdu, err := card.Transmit(apdu)
+	if err != nil {
+		return err
+	}
+	sw, _ := DecodeResponseAPDU(rapdu)
+	if sw != 0x9000 {
+		return cardError(sw)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/kr/pretty"
+)
+
+// printFile prints a FileResult the way the tool always has: the raw
+// hex on success, or the error message.
+func printFile(w io.Writer, name string, f FileResult) {
+	fmt.Fprintln(w, name)
+	if f.Error != "" {
+		fmt.Fprintf(w, "\terr: %s\n", f.Error)
+		return
+	}
+	fmt.Fprintf(w, "\t%s\n", f.Hex)
+}
+
+func printMFDump(w io.Writer, mf *MFDump) {
+	printFile(w, "mf/ef.atr", mf.ATR)
+
+	fmt.Fprintln(w, "mf/ef.dir")
+	for _, f := range mf.Dir {
+		if f.Error != "" {
+			fmt.Fprintf(w, "\t[%d] err: %s\n", f.Index, f.Error)
+		} else if f.AID != "" {
+			fmt.Fprintf(w, "\t[%d]: aid=%s label=%q\n", f.Index, f.AID, f.Label)
+		} else {
+			fmt.Fprintf(w, "\t[%d]: %s\n", f.Index, f.Hex)
+		}
+	}
+
+	fmt.Fprintln(w, "mf/ef.gdo")
+	if mf.GDO.Error != "" {
+		fmt.Fprintf(w, "\terr: %s\n", mf.GDO.Error)
+	} else {
+		fmt.Fprintf(w, "\t%s\n", mf.GDO.Hex)
+		if mf.ICCSN != nil {
+			pretty.Fprintf(w, "\t%# v\n", mf.ICCSN)
+		}
+	}
+
+	fmt.Fprintln(w, "mf/ef.version")
+	for _, f := range mf.Version {
+		if f.Error != "" {
+			fmt.Fprintf(w, "\t[%d] err: %s\n", f.Index, f.Error)
+		} else {
+			fmt.Fprintf(w, "\t[%d]: %s // %q\n", f.Index, f.Hex, f.Version)
+		}
+	}
+
+	for _, c := range mf.Certs {
+		printFile(w, c.Name, c.FileResult)
+	}
+}
+
+func printHCADump(w io.Writer, hca *HCADump) {
+	fmt.Fprintln(w, "hca/ef.statusvd")
+	if hca.StatusVD.Error != "" {
+		fmt.Fprintf(w, "\terr: %s\n", hca.StatusVD.Error)
+	} else if hca.StatusVDParsed != nil {
+		pretty.Fprintf(w, "%# v\n", hca.StatusVDParsed)
+	}
+
+	fmt.Fprintln(w, "hca/ef.pd")
+	if hca.PD.Error != "" {
+		fmt.Fprintf(w, "\terr: %s\n", hca.PD.Error)
+	} else if hca.PDParsed != nil {
+		pretty.Fprintf(w, "%# v\n", hca.PDParsed)
+	}
+
+	fmt.Fprintln(w, "hca/ef.vd")
+	if hca.VD.Error != "" {
+		fmt.Fprintf(w, "\terr: %s\n", hca.VD.Error)
+	} else if hca.VDParsed != nil {
+		pretty.Fprintf(w, "%# v\n", hca.VDParsed)
+	}
+
+	fmt.Fprintln(w, "hca/ef.gvd")
+	if hca.GVD.Error != "" {
+		fmt.Fprintf(w, "\terr: %s\n", hca.GVD.Error)
+	} else if hca.GVDParsed != nil {
+		pretty.Fprintf(w, "%# v\n", hca.GVDParsed)
+	}
+}
+
+func printEsignCert(w io.Writer, name string, c CertResult) {
+	fmt.Fprintln(w, name)
+	if c.Error != "" {
+		fmt.Fprintf(w, "\terr: %s\n", c.Error)
+		if c.Hex != "" {
+			fmt.Fprintf(w, "\t%s\n", c.Hex)
+		}
+		return
+	}
+	fmt.Fprintf(w, "\tsubject: %s\n", c.Subject)
+	fmt.Fprintf(w, "\tissuer: %s\n", c.Issuer)
+	fmt.Fprint(w, c.PEM)
+}
+
+func printEsignDump(w io.Writer, esign *EsignDump) {
+	printEsignCert(w, "esign/ef.c.ch.aut", esign.CAut)
+	printEsignCert(w, "esign/ef.c.ch.enc", esign.CEnc)
+}
+
+// printText renders a CardDump the way the tool has always printed to
+// stdout, section by section.
+func printText(w io.Writer, dump *CardDump) {
+	if dump.MF != nil {
+		printMFDump(w, dump.MF)
+	}
+	if dump.HCA != nil {
+		printHCADump(w, dump.HCA)
+	}
+	if dump.Esign != nil {
+		printEsignDump(w, dump.Esign)
+	}
+}
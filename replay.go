@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReplayCard is a Card implementation that answers Transmit calls from
+// a previously recorded APDU transcript (as produced by apduLogger)
+// instead of a physical card, so that dump flows can be exercised
+// offline and regression-tested against a fixed corpus.
+type ReplayCard struct {
+	responses map[string][][]byte
+}
+
+// NewReplayCard parses an APDU transcript of alternating "c-apdu: <hex>"
+// and "r-apdu: <hex>" lines and returns a ReplayCard that replays it.
+func NewReplayCard(r io.Reader) (*ReplayCard, error) {
+	rc := &ReplayCard{responses: make(map[string][][]byte)}
+
+	var pendingCmd []byte
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "c-apdu:"):
+			if pendingCmd != nil {
+				rc.record(pendingCmd, nil)
+			}
+			cmd, err := decodeHexField(line, "c-apdu:")
+			if err != nil {
+				return nil, err
+			}
+			pendingCmd = cmd
+		case strings.HasPrefix(line, "r-apdu:"):
+			if pendingCmd == nil {
+				return nil, fmt.Errorf("replay: r-apdu without preceding c-apdu")
+			}
+			rsp, err := decodeHexField(line, "r-apdu:")
+			if err != nil {
+				return nil, err
+			}
+			rc.record(pendingCmd, rsp)
+			pendingCmd = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if pendingCmd != nil {
+		rc.record(pendingCmd, nil)
+	}
+
+	return rc, nil
+}
+
+func (rc *ReplayCard) record(cmd, rsp []byte) {
+	key := hex.EncodeToString(cmd)
+	rc.responses[key] = append(rc.responses[key], rsp)
+}
+
+func decodeHexField(line, prefix string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimSpace(strings.TrimPrefix(line, prefix)))
+}
+
+// Transmit looks up the next recorded response for cmd, in the order
+// it was recorded.
+func (rc *ReplayCard) Transmit(cmd []byte) ([]byte, error) {
+	key := hex.EncodeToString(cmd)
+	queue := rc.responses[key]
+	if len(queue) == 0 {
+		return nil, fmt.Errorf("replay: no recorded response for %x", cmd)
+	}
+	rsp := queue[0]
+	rc.responses[key] = queue[1:]
+	if rsp == nil {
+		return nil, fmt.Errorf("replay: recorded exchange for %x has no response", cmd)
+	}
+	return rsp, nil
+}
@@ -0,0 +1,121 @@
+package sm
+
+import "fmt"
+
+// apduMaxExtended mirrors the main package's constant of the same
+// name: the value an extended-form Lc of 0x0000 stands for.
+const apduMaxExtended = 0xffff + 1
+
+// cardError mirrors the main package's cardError: the status word of a
+// response that did not indicate success.
+type cardError uint16
+
+func (ce cardError) Error() string {
+	return fmt.Sprintf("sm: sw=%x", uint16(ce))
+}
+
+// mseSetAT issues MSE:Set AT (CLA=00, INS=22, P1=C1, P2=A4) selecting
+// PACE with the generic EC mapping and the given password reference.
+func mseSetAT(card Card, pwdRef byte) error {
+	crt := encodeDO(0x80, oidPaceECDHGMAESCBCCMAC128)
+	crt = append(crt, encodeDO(0x83, []byte{pwdRef})...)
+
+	apdu := append([]byte{0x00, 0x22, 0xc1, 0xa4}, byte(len(crt)))
+	apdu = append(apdu, crt...)
+
+	rsp, err := card.Transmit(apdu)
+	if err != nil {
+		return err
+	}
+	return checkSW(rsp)
+}
+
+// generalAuthenticate wraps data in dynamic authentication data DO'7C'
+// and issues a GENERAL AUTHENTICATE command (CLA=00/10, INS=86),
+// returning the value of the expected response tag.
+func generalAuthenticate(card Card, data []byte, rspTag byte) ([]byte, error) {
+	cla := byte(0x10)
+	if rspTag == 0x86 {
+		cla = 0x00
+	}
+
+	cmdData := encodeDO(0x7c, data)
+	apdu := append([]byte{cla, 0x86, 0x00, 0x00}, byte(len(cmdData)))
+	apdu = append(apdu, cmdData...)
+	apdu = append(apdu, 0x00)
+
+	rsp, err := card.Transmit(apdu)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSW(rsp); err != nil {
+		return nil, err
+	}
+
+	body := rsp[:len(rsp)-2]
+	if len(body) < 1 || body[0] != 0x7c {
+		return nil, fmt.Errorf("sm: general authenticate response missing DO'7C'")
+	}
+	n, lenLen, err := decodeLength(body[1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < 1+lenLen+n {
+		return nil, fmt.Errorf("sm: general authenticate response DO'7C' value truncated")
+	}
+	dos, err := parseDOs(body[1+lenLen : 1+lenLen+n])
+	if err != nil {
+		return nil, err
+	}
+	val, ok := dos[rspTag]
+	if !ok {
+		return nil, fmt.Errorf("sm: general authenticate response missing tag %#x", rspTag)
+	}
+	return val, nil
+}
+
+func checkSW(rsp []byte) error {
+	if len(rsp) < 2 {
+		return fmt.Errorf("sm: response apdu too short")
+	}
+	sw := uint16(rsp[len(rsp)-2])<<8 | uint16(rsp[len(rsp)-1])
+	if sw != 0x9000 {
+		return cardError(sw)
+	}
+	return nil
+}
+
+// decodeExtendedLen decodes a two-byte extended-form Lc field, where
+// 0x0000 stands for apduMaxExtended.
+func decodeExtendedLen(hi, lo byte) int {
+	n := int(hi)<<8 | int(lo)
+	if n == 0 {
+		return apduMaxExtended
+	}
+	return n
+}
+
+// encodeAPDULc encodes the Lc field of the protected command APDU
+// itself (ISO/IEC 7816-4 wire format, not the BER length encoding
+// encodeDO uses for data object values): absent for n==0, else a
+// single byte in short form or a 0x00-prefixed two-byte field in
+// extended form.
+func encodeAPDULc(n int, extended bool) []byte {
+	if n == 0 {
+		return nil
+	}
+	if !extended {
+		return []byte{byte(n)}
+	}
+	return []byte{0x00, byte(n >> 8), byte(n)}
+}
+
+// encodeAPDULe encodes a wildcard Le ("return whatever the command
+// produces") for the protected command APDU, in the same short- or
+// extended-form width as its Lc.
+func encodeAPDULe(extended bool) []byte {
+	if !extended {
+		return []byte{0x00}
+	}
+	return []byte{0x00, 0x00}
+}
@@ -0,0 +1,72 @@
+package sm
+
+import "crypto/aes"
+
+// cmac computes AES-CMAC (NIST SP 800-38B) of msg under key.
+func cmac(key, msg []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	blockSize := block.BlockSize()
+	k1, k2 := cmacSubkeys(block)
+
+	n := (len(msg) + blockSize - 1) / blockSize
+	complete := n > 0 && len(msg)%blockSize == 0
+	if n == 0 {
+		n = 1
+		complete = false
+	}
+
+	last := make([]byte, blockSize)
+	copy(last, msg[(n-1)*blockSize:])
+	if complete {
+		xorBlock(last, msg[(n-1)*blockSize:], k1)
+	} else {
+		last[len(msg)-(n-1)*blockSize] = 0x80
+		xorBlock(last, last, k2)
+	}
+
+	iv := make([]byte, blockSize)
+	buf := make([]byte, blockSize)
+	for i := 0; i < n-1; i++ {
+		xorBlock(buf, msg[i*blockSize:(i+1)*blockSize], iv)
+		block.Encrypt(iv, buf)
+	}
+	xorBlock(buf, last, iv)
+	out := make([]byte, blockSize)
+	block.Encrypt(out, buf)
+	return out, nil
+}
+
+func cmacSubkeys(block interface{ Encrypt(dst, src []byte) }) (k1, k2 []byte) {
+	const rb = 0x87 // Rb for a 128 bit block size, SP 800-38B 5.3
+
+	zero := make([]byte, 16)
+	l := make([]byte, 16)
+	block.Encrypt(l, zero)
+
+	k1 = shiftLeftXorRb(l, rb)
+	k2 = shiftLeftXorRb(k1, rb)
+	return k1, k2
+}
+
+func shiftLeftXorRb(in []byte, rb byte) []byte {
+	out := make([]byte, len(in))
+	msb := in[0]&0x80 != 0
+	var carry byte
+	for i := len(in) - 1; i >= 0; i-- {
+		out[i] = in[i]<<1 | carry
+		carry = in[i] >> 7
+	}
+	if msb {
+		out[len(out)-1] ^= rb
+	}
+	return out
+}
+
+func xorBlock(dst, a, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
@@ -0,0 +1,60 @@
+package sm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestCMACKnownAnswer checks cmac against the NIST SP 800-38B
+// AES-128 CMAC known-answer test vectors (Appendix D.1), covering an
+// empty message, a single complete block, and a message spanning
+// several blocks with a final partial block.
+func TestCMACKnownAnswer(t *testing.T) {
+	key := mustHex(t, "2b7e151628aed2a6abf7158809cf4f3c")
+
+	tests := []struct {
+		name string
+		msg  string
+		mac  string
+	}{
+		{
+			name: "empty",
+			msg:  "",
+			mac:  "bb1d6929e95937287fa37d129b756746",
+		},
+		{
+			name: "one block",
+			msg:  "6bc1bee22e409f96e93d7e117393172a",
+			mac:  "070a16b46b4d4144f79bdd9dd04a287c",
+		},
+		{
+			name: "two blocks, partial",
+			msg:  "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411",
+			mac:  "dfa66747de9ae63030ca32611497c827",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := mustHex(t, tc.msg)
+			want := mustHex(t, tc.mac)
+			got, err := cmac(key, msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("cmac = %x, want %x", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package sm
+
+import "fmt"
+
+// encodeLength BER-encodes a length in short or (two-byte) long form.
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	if n <= 0xff {
+		return []byte{0x81, byte(n)}
+	}
+	return []byte{0x82, byte(n >> 8), byte(n)}
+}
+
+// encodeDO encodes a primitive data object with a single-byte tag, as
+// used throughout TR-03110 secure messaging (0x87, 0x8e, 0x97, 0x99)
+// and the PACE dynamic authentication data (0x7c, 0x80-0x86).
+func encodeDO(tag byte, value []byte) []byte {
+	do := append([]byte{tag}, encodeLength(len(value))...)
+	return append(do, value...)
+}
+
+// parseDOs parses a flat sequence of single-byte-tag BER-TLV data
+// objects, as found inside DO'7C' and secure messaging response APDUs.
+func parseDOs(raw []byte) (map[byte][]byte, error) {
+	dos := make(map[byte][]byte)
+	for len(raw) > 0 {
+		tag := raw[0]
+		raw = raw[1:]
+		if len(raw) == 0 {
+			return nil, fmt.Errorf("sm: truncated data object")
+		}
+		n, lenLen, err := decodeLength(raw)
+		if err != nil {
+			return nil, err
+		}
+		raw = raw[lenLen:]
+		if len(raw) < n {
+			return nil, fmt.Errorf("sm: data object value truncated")
+		}
+		dos[tag] = raw[:n]
+		raw = raw[n:]
+	}
+	return dos, nil
+}
+
+// encodePublicKeyDO builds the Public Key data object (tag '7F49')
+// used as input to the PACE mutual authentication token MAC, holding
+// the algorithm OID (tag '06') and the public point (tag '86').
+func encodePublicKeyDO(oid, point []byte) []byte {
+	content := append(encodeDO(0x06, oid), encodeDO(0x86, point)...)
+	do := append([]byte{0x7f, 0x49}, encodeLength(len(content))...)
+	return append(do, content...)
+}
+
+func decodeLength(raw []byte) (n, lenLen int, err error) {
+	if len(raw) == 0 {
+		return 0, 0, fmt.Errorf("sm: missing length")
+	}
+	if raw[0] < 0x80 {
+		return int(raw[0]), 1, nil
+	}
+	nbytes := int(raw[0] &^ 0x80)
+	if nbytes == 0 || nbytes > 4 || len(raw) < 1+nbytes {
+		return 0, 0, fmt.Errorf("sm: invalid length encoding")
+	}
+	for _, b := range raw[1 : 1+nbytes] {
+		n = n<<8 | int(b)
+	}
+	return n, 1 + nbytes, nil
+}
@@ -0,0 +1,103 @@
+package sm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeDecodeLength(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{0x7f, []byte{0x7f}},
+		{0x80, []byte{0x81, 0x80}},
+		{0xff, []byte{0x81, 0xff}},
+		{0x100, []byte{0x82, 0x01, 0x00}},
+		{0xffff, []byte{0x82, 0xff, 0xff}},
+	}
+	for _, tc := range tests {
+		got := encodeLength(tc.n)
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("encodeLength(%#x) = % x, want % x", tc.n, got, tc.want)
+		}
+		n, lenLen, err := decodeLength(append(got, 0xaa, 0xbb))
+		if err != nil {
+			t.Fatalf("decodeLength(%#x): %s", tc.n, err)
+		}
+		if n != tc.n {
+			t.Errorf("decodeLength: n = %#x, want %#x", n, tc.n)
+		}
+		if lenLen != len(tc.want) {
+			t.Errorf("decodeLength: lenLen = %d, want %d", lenLen, len(tc.want))
+		}
+	}
+}
+
+func TestDecodeLengthErrors(t *testing.T) {
+	tests := [][]byte{
+		{},                 // missing length
+		{0x80},             // indefinite/reserved, not a valid short or long form here
+		{0x83, 0x01, 0x02}, // claims 3 length-of-length bytes but only 2 follow
+	}
+	for _, raw := range tests {
+		if _, _, err := decodeLength(raw); err == nil {
+			t.Errorf("decodeLength(% x): expected error, got nil", raw)
+		}
+	}
+}
+
+func TestEncodeDecodeDO(t *testing.T) {
+	value := []byte{0x01, 0x02, 0x03, 0x04, 0x05}
+	do := encodeDO(0x87, value)
+	want := append([]byte{0x87, 0x05}, value...)
+	if !bytes.Equal(do, want) {
+		t.Fatalf("encodeDO = % x, want % x", do, want)
+	}
+
+	dos, err := parseDOs(do)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dos[0x87], value) {
+		t.Errorf("parseDOs[0x87] = % x, want % x", dos[0x87], value)
+	}
+}
+
+func TestParseDOsMultiple(t *testing.T) {
+	raw := append(encodeDO(0x87, []byte{0x01}), encodeDO(0x97, []byte{0x02, 0x03})...)
+	raw = append(raw, encodeDO(0x8e, []byte{0xaa, 0xbb, 0xcc, 0xdd})...)
+
+	dos, err := parseDOs(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dos[0x87], []byte{0x01}) {
+		t.Errorf("dos[0x87] = % x", dos[0x87])
+	}
+	if !bytes.Equal(dos[0x97], []byte{0x02, 0x03}) {
+		t.Errorf("dos[0x97] = % x", dos[0x97])
+	}
+	if !bytes.Equal(dos[0x8e], []byte{0xaa, 0xbb, 0xcc, 0xdd}) {
+		t.Errorf("dos[0x8e] = % x", dos[0x8e])
+	}
+}
+
+func TestParseDOsTruncated(t *testing.T) {
+	// Tag '87', length '05', but only 2 value bytes follow.
+	raw := []byte{0x87, 0x05, 0x01, 0x02}
+	if _, err := parseDOs(raw); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestEncodePublicKeyDO(t *testing.T) {
+	oid := []byte{0x01, 0x02}
+	point := []byte{0x03, 0x04, 0x05}
+	got := encodePublicKeyDO(oid, point)
+	want := []byte{0x7f, 0x49, 0x09, 0x06, 0x02, 0x01, 0x02, 0x86, 0x03, 0x03, 0x04, 0x05}
+	if !bytes.Equal(got, want) {
+		t.Errorf("encodePublicKeyDO = % x, want % x", got, want)
+	}
+}
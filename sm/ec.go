@@ -0,0 +1,54 @@
+package sm
+
+import (
+	"crypto/elliptic"
+	"io"
+	"math/big"
+)
+
+// randomScalar returns a uniformly random integer in [1, N-1] suitable
+// as a scalar for curve, where N is the order of curve's base point.
+func randomScalar(rnd io.Reader, curve elliptic.Curve) ([]byte, error) {
+	n := curve.Params().N
+	bitSize := n.BitLen()
+	byteLen := (bitSize + 7) / 8
+	buf := make([]byte, byteLen)
+	for {
+		if _, err := io.ReadFull(rnd, buf); err != nil {
+			return nil, err
+		}
+		if excess := uint(byteLen*8 - bitSize); excess > 0 {
+			buf[0] &= 0xff >> excess
+		}
+
+		k := new(big.Int).SetBytes(buf)
+		if k.Sign() != 0 && k.Cmp(n) < 0 {
+			return buf, nil
+		}
+	}
+}
+
+// ecGenerateKey generates an ephemeral EC key pair on curve's own base
+// point, returning the private scalar and the public point.
+func ecGenerateKey(rnd io.Reader, curve elliptic.Curve) (priv []byte, x, y *big.Int, err error) {
+	priv, err = randomScalar(rnd, curve)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	x, y = curve.ScalarBaseMult(priv)
+	return priv, x, y, nil
+}
+
+// leftPad returns b zero-padded on the left to size bytes, as required
+// to encode an EC field element (e.g. an ECDH shared secret's
+// x-coordinate) as a fixed-length octet string: big.Int.Bytes() drops
+// leading zero bytes, which would otherwise silently shrink the
+// encoding whenever the coordinate happens to start with one.
+func leftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
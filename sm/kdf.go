@@ -0,0 +1,53 @@
+package sm
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// KDF counters from BSI TR-03110 Part 3, Sec. A.2.3.
+const (
+	kdfEnc      = 1
+	kdfMac      = 2
+	kdfPassword = 3
+)
+
+// kdf implements the TR-03110 key derivation function: the shared
+// secret is hashed together with a 4-byte big-endian counter and the
+// result truncated to keyLen bytes. SHA-1 is used for 3DES/AES-128
+// keys, SHA-256 for AES-192/256 keys.
+func kdf(secret []byte, counter uint32, keyLen int) []byte {
+	var ctr [4]byte
+	binary.BigEndian.PutUint32(ctr[:], counter)
+
+	if keyLen <= 16 {
+		h := sha1.New()
+		h.Write(secret)
+		h.Write(ctr[:])
+		return h.Sum(nil)[:keyLen]
+	}
+
+	h := sha256.New()
+	h.Write(secret)
+	h.Write(ctr[:])
+	return h.Sum(nil)[:keyLen]
+}
+
+// kdfEncKey derives the AES-128 secure messaging encryption key from
+// the PACE/TA/CA shared secret K.
+func kdfEncKey(k []byte) []byte {
+	return kdf(k, kdfEnc, 16)
+}
+
+// kdfMacKey derives the AES-128 secure messaging MAC key from the
+// PACE/TA/CA shared secret K.
+func kdfMacKey(k []byte) []byte {
+	return kdf(k, kdfMac, 16)
+}
+
+// kdfPasswordKey derives K_pi, the key used to decrypt the PACE nonce,
+// from the CAN as printed on the card.
+func kdfPasswordKey(can string) []byte {
+	return kdf([]byte(can), kdfPassword, 16)
+}
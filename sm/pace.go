@@ -0,0 +1,132 @@
+package sm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+)
+
+// passwordRefCAN is the password reference for the CAN, TR-03110
+// Part 3, Table 7 (PACE "password" values for CRT tag '83').
+const passwordRefCAN = 0x02
+
+// oidPaceECDHGMAESCBCCMAC128 is id-PACE-ECDH-GM-AES-CBC-CMAC-128,
+// BSI TR-03110 Part 3, Sec. A.1.1.5, DER-encoded.
+var oidPaceECDHGMAESCBCCMAC128 = []byte{
+	0x04, 0x00, 0x7f, 0x00, 0x07, 0x02, 0x02, 0x04, 0x02, 0x02,
+}
+
+// PACE performs a PACE key agreement over card using the generic EC
+// mapping with AES-128 session keys, authenticating with the six-digit
+// CAN printed on the card, and returns a SecureChannel ready to carry
+// the subsequent protected APDUs.
+func PACE(card Card, can string, curve elliptic.Curve) (*SecureChannel, error) {
+	kpi := kdfPasswordKey(can)
+
+	if err := mseSetAT(card, passwordRefCAN); err != nil {
+		return nil, fmt.Errorf("sm: MSE:Set AT: %w", err)
+	}
+
+	encNonce, err := generalAuthenticate(card, nil, 0x80)
+	if err != nil {
+		return nil, fmt.Errorf("sm: general authenticate (nonce): %w", err)
+	}
+	nonce, err := decryptNonce(kpi, encNonce)
+	if err != nil {
+		return nil, fmt.Errorf("sm: decrypting nonce: %w", err)
+	}
+
+	mapSK, mapPKx, mapPKy, err := ecGenerateKey(rand.Reader, curve)
+	if err != nil {
+		return nil, err
+	}
+	mapPK := elliptic.Marshal(curve, mapPKx, mapPKy)
+
+	rsp, err := generalAuthenticate(card, encodeDO(0x81, mapPK), 0x82)
+	if err != nil {
+		return nil, fmt.Errorf("sm: general authenticate (map): %w", err)
+	}
+	cardMapPKx, cardMapPKy := elliptic.Unmarshal(curve, rsp)
+	if cardMapPKx == nil {
+		return nil, fmt.Errorf("sm: invalid mapping public key from card")
+	}
+
+	hx, hy := curve.ScalarMult(cardMapPKx, cardMapPKy, mapSK)
+	gx, gy := mapGeneric(curve, nonce, hx, hy)
+
+	ephSK, ephPKx, ephPKy, err := generateKeyOn(curve, gx, gy)
+	if err != nil {
+		return nil, err
+	}
+	ephPK := elliptic.Marshal(curve, ephPKx, ephPKy)
+
+	rsp, err = generalAuthenticate(card, encodeDO(0x83, ephPK), 0x84)
+	if err != nil {
+		return nil, fmt.Errorf("sm: general authenticate (key agreement): %w", err)
+	}
+	cardEphPKx, cardEphPKy := elliptic.Unmarshal(curve, rsp)
+	if cardEphPKx == nil {
+		return nil, fmt.Errorf("sm: invalid ephemeral public key from card")
+	}
+	cardEphPK := elliptic.Marshal(curve, cardEphPKx, cardEphPKy)
+
+	sharedX, _ := curve.ScalarMult(cardEphPKx, cardEphPKy, ephSK)
+	sharedSecret := leftPad(sharedX.Bytes(), (curve.Params().BitSize+7)/8)
+	kenc := kdfEncKey(sharedSecret)
+	kmac := kdfMacKey(sharedSecret)
+
+	tpcd, err := cmac(kmac, encodePublicKeyDO(oidPaceECDHGMAESCBCCMAC128, cardEphPK))
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err = generalAuthenticate(card, encodeDO(0x85, tpcd[:8]), 0x86)
+	if err != nil {
+		return nil, fmt.Errorf("sm: general authenticate (mutual auth): %w", err)
+	}
+
+	tpicc, err := cmac(kmac, encodePublicKeyDO(oidPaceECDHGMAESCBCCMAC128, ephPK))
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(tpicc[:8], rsp) != 1 {
+		return nil, fmt.Errorf("sm: card authentication token mismatch")
+	}
+
+	return newSecureChannel(card, kenc, kmac), nil
+}
+
+// mapGeneric computes the mapped generic-mapping generator
+// G~ = [nonce]G + H, as specified in TR-03110 Part 3, Sec. 4.3.3.2.
+func mapGeneric(curve elliptic.Curve, nonce []byte, hx, hy *big.Int) (x, y *big.Int) {
+	sx, sy := curve.ScalarBaseMult(nonce)
+	return curve.Add(sx, sy, hx, hy)
+}
+
+func decryptNonce(kpi, enc []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kpi)
+	if err != nil {
+		return nil, err
+	}
+	if len(enc)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("encrypted nonce not block aligned")
+	}
+	dec := make([]byte, len(enc))
+	cipher.NewCBCDecrypter(block, make([]byte, block.BlockSize())).CryptBlocks(dec, enc)
+	return dec, nil
+}
+
+// generateKeyOn generates an ephemeral key pair for the mapped domain
+// parameters: same curve, but base point (gx, gy) instead of curve's G.
+func generateKeyOn(curve elliptic.Curve, gx, gy *big.Int) (priv []byte, x, y *big.Int, err error) {
+	priv, err = randomScalar(rand.Reader, curve)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	x, y = curve.ScalarMult(gx, gy, priv)
+	return priv, x, y, nil
+}
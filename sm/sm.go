@@ -0,0 +1,278 @@
+// Package sm implements BSI TR-03110 Secure Messaging and the PACE key
+// agreement protocol used to open a trusted channel to an eGK over a
+// contactless interface.
+package sm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"fmt"
+)
+
+// Card is the subset of the main package's Card interface needed to
+// exchange APDUs with the card.
+type Card interface {
+	Transmit(cmd []byte) ([]byte, error)
+}
+
+// SecureChannel wraps a Card and transparently encrypts/authenticates
+// every command APDU and verifies/decrypts every response APDU using
+// the session keys established by PACE. A response consisting of a
+// status word alone carries no DO'8E' and is passed through unverified.
+type SecureChannel struct {
+	card Card
+
+	kenc []byte
+	kmac []byte
+	ssc  []byte
+}
+
+func newSecureChannel(card Card, kenc, kmac []byte) *SecureChannel {
+	return &SecureChannel{
+		card: card,
+		kenc: kenc,
+		kmac: kmac,
+		ssc:  make([]byte, aes.BlockSize),
+	}
+}
+
+func (sc *SecureChannel) incSSC() {
+	for i := len(sc.ssc) - 1; i >= 0; i-- {
+		sc.ssc[i]++
+		if sc.ssc[i] != 0 {
+			return
+		}
+	}
+}
+
+// pad applies the ISO/IEC 9797-1 padding method 2 (0x80 followed by
+// zero bytes) up to the cipher's block size.
+func pad(data []byte, blockSize int) []byte {
+	padded := append([]byte{}, data...)
+	padded = append(padded, 0x80)
+	for len(padded)%blockSize != 0 {
+		padded = append(padded, 0)
+	}
+	return padded
+}
+
+func unpad(data []byte) ([]byte, error) {
+	for i := len(data) - 1; i >= 0; i-- {
+		switch data[i] {
+		case 0x80:
+			return data[:i], nil
+		case 0x00:
+			continue
+		default:
+			return nil, fmt.Errorf("sm: invalid padding")
+		}
+	}
+	return nil, fmt.Errorf("sm: invalid padding")
+}
+
+// encryptCmdData returns the value of DO'87' (padded, CBC/AES-128
+// enciphered command data, prefixed with the padding-content indicator
+// byte 0x01) for the current send-sequence counter.
+func (sc *SecureChannel) encryptCmdData(data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(sc.kenc)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := sc.ivForSSC()
+	if err != nil {
+		return nil, err
+	}
+	padded := pad(data, block.BlockSize())
+	enc := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(enc, padded)
+	return append([]byte{0x01}, enc...), nil
+}
+
+func (sc *SecureChannel) decryptRspData(do87 []byte) ([]byte, error) {
+	if len(do87) < 1 || do87[0] != 0x01 {
+		return nil, fmt.Errorf("sm: unsupported DO'87' padding indicator")
+	}
+	enc := do87[1:]
+	block, err := aes.NewCipher(sc.kenc)
+	if err != nil {
+		return nil, err
+	}
+	if len(enc)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("sm: DO'87' not block aligned")
+	}
+	iv, err := sc.ivForSSC()
+	if err != nil {
+		return nil, err
+	}
+	dec := make([]byte, len(enc))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(dec, enc)
+	return unpad(dec)
+}
+
+// ivForSSC derives the SM IV as Enc(K_enc, SSC), as specified for
+// AES-CBC secure messaging in TR-03110.
+func (sc *SecureChannel) ivForSSC() ([]byte, error) {
+	block, err := aes.NewCipher(sc.kenc)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, block.BlockSize())
+	block.Encrypt(iv, sc.ssc)
+	return iv, nil
+}
+
+// Transmit applies secure messaging to cmd, transmits the protected
+// APDU over the underlying Card and unwraps/verifies the response.
+func (sc *SecureChannel) Transmit(cmd []byte) ([]byte, error) {
+	if len(cmd) < 4 {
+		return nil, fmt.Errorf("sm: apdu too short")
+	}
+
+	cla, ins, p1, p2 := cmd[0]|0x0c, cmd[1], cmd[2], cmd[3]
+	data, le, extended, err := splitCommandAPDU(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	sc.incSSC()
+
+	var dos []byte
+	if len(data) > 0 {
+		enc, err := sc.encryptCmdData(data)
+		if err != nil {
+			return nil, err
+		}
+		dos = append(dos, encodeDO(0x87, enc)...)
+	}
+	if len(le) > 0 {
+		dos = append(dos, encodeDO(0x97, le)...)
+	}
+
+	header := []byte{cla, ins, p1, p2}
+	header = pad(header, aes.BlockSize)
+	macInput := append(append([]byte{}, sc.ssc...), header...)
+	macInput = append(macInput, dos...)
+	macInput = pad(macInput, aes.BlockSize)
+
+	macValue, err := cmac(sc.kmac, macInput)
+	if err != nil {
+		return nil, err
+	}
+	dos = append(dos, encodeDO(0x8e, macValue[:8])...)
+
+	// The protected command must use extended-form Lc/Le throughout
+	// whenever the original command did (so its Le can still express
+	// a large expected response length), or whenever dos itself grew
+	// past what a short-form Lc can hold.
+	protExtended := extended || len(dos) > 0xff
+	protected := append([]byte{cla, ins, p1, p2}, encodeAPDULc(len(dos), protExtended)...)
+	protected = append(protected, dos...)
+	protected = append(protected, encodeAPDULe(protExtended)...)
+
+	rsp, err := sc.card.Transmit(protected)
+	if err != nil {
+		return nil, err
+	}
+	return sc.unwrapResponse(rsp)
+}
+
+func (sc *SecureChannel) unwrapResponse(rsp []byte) ([]byte, error) {
+	if len(rsp) < 2 {
+		return nil, fmt.Errorf("sm: response apdu too short")
+	}
+	sw := rsp[len(rsp)-2:]
+	body := rsp[:len(rsp)-2]
+
+	sc.incSSC()
+
+	if len(body) == 0 {
+		return sw, nil
+	}
+
+	rdos, err := parseDOs(body)
+	if err != nil {
+		return nil, err
+	}
+
+	recvdMac, ok := rdos[0x8e]
+	if !ok {
+		return nil, fmt.Errorf("sm: response missing DO'8E'")
+	}
+
+	var macInput []byte
+	macInput = append(macInput, sc.ssc...)
+	if do87, ok := rdos[0x87]; ok {
+		macInput = append(macInput, encodeDO(0x87, do87)...)
+	}
+	if do99, ok := rdos[0x99]; ok {
+		macInput = append(macInput, encodeDO(0x99, do99)...)
+	}
+	macInput = pad(macInput, aes.BlockSize)
+
+	expectedMac, err := cmac(sc.kmac, macInput)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(expectedMac[:8], recvdMac) != 1 {
+		return nil, fmt.Errorf("sm: response cryptographic checksum mismatch")
+	}
+
+	var plain []byte
+	if do87, ok := rdos[0x87]; ok {
+		plain, err = sc.decryptRspData(do87)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return append(plain, sw...), nil
+}
+
+// splitCommandAPDU extracts the Lc-length data and the raw Le field
+// (nil if absent) from a command APDU as produced by EncodeAPDU in
+// the main package, recognizing both its short-form (1-byte Lc/Le)
+// and extended-form (0x00-prefixed, 2-byte Lc/Le) wire encodings. Le
+// is returned as the raw field bytes, not decoded to an int, since
+// DO'97' carries it verbatim (TR-03110 Part 3, Sec. 9.2.3) and the
+// short/extended width is exactly what distinguishes "256"/"65536"
+// from the wildcard encoding '00'/'0000'.
+func splitCommandAPDU(cmd []byte) (data, le []byte, extended bool, err error) {
+	body := cmd[4:]
+	switch {
+	case len(body) == 0:
+		return nil, nil, false, nil
+	case len(body) == 1:
+		return nil, body, false, nil
+	case len(body) == 3 && body[0] == 0x00:
+		// Extended form with no data: a lone 0x00-prefixed Le field.
+		return nil, body[1:], true, nil
+	case body[0] == 0x00:
+		if len(body) < 3 {
+			return nil, nil, false, fmt.Errorf("sm: truncated extended-length apdu")
+		}
+		lc := decodeExtendedLen(body[1], body[2])
+		if len(body) < 3+lc {
+			return nil, nil, false, fmt.Errorf("sm: apdu shorter than extended Lc")
+		}
+		data = body[3 : 3+lc]
+		switch rest := body[3+lc:]; len(rest) {
+		case 0:
+			return data, nil, true, nil
+		case 2:
+			return data, rest, true, nil
+		default:
+			return nil, nil, false, fmt.Errorf("sm: malformed extended-length apdu trailer")
+		}
+	default:
+		lc := int(body[0])
+		if len(body) < 1+lc {
+			return nil, nil, false, fmt.Errorf("sm: apdu shorter than Lc")
+		}
+		data = body[1 : 1+lc]
+		if len(body) == 1+lc {
+			return data, nil, false, nil
+		}
+		return data, body[1+lc:], false, nil
+	}
+}